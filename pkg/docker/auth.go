@@ -0,0 +1,67 @@
+package docker
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/docker/cli/cli/config"
+	"github.com/docker/distribution/reference"
+	dockerregistry "github.com/docker/docker/registry"
+
+	"github.com/docker/docker/api/types"
+)
+
+// registryHostnameForAuth returns the ~/.docker/config.json key to look
+// credentials up under for image: normally the registry domain, except
+// Docker Hub images, which normalize to the "docker.io" domain but are keyed
+// under the legacy index URL by `docker login` and the config file - the
+// same special case the docker CLI's ResolveAuthConfig makes.
+func registryHostnameForAuth(image string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", fmt.Errorf("Failed to parse image reference %s: %w", image, err)
+	}
+	hostname := reference.Domain(named)
+	if hostname == "docker.io" {
+		hostname = dockerregistry.IndexServer
+	}
+	return hostname, nil
+}
+
+// ResolveAuth looks up credentials for the registry hosting image in the
+// user's ~/.docker/config.json (following credential-helpers/credential-store,
+// same as the docker CLI) and returns them as the base64-encoded AuthConfig
+// JSON expected by RegistryAuth on client.ImagePull/client.ImagePush.
+func ResolveAuth(image string) (string, error) {
+	hostname, err := registryHostnameForAuth(image)
+	if err != nil {
+		return "", err
+	}
+
+	configFile, err := config.Load(config.Dir())
+	if err != nil {
+		return "", fmt.Errorf("Failed to load Docker config: %w", err)
+	}
+
+	cliAuth, err := configFile.GetAuthConfig(hostname)
+	if err != nil {
+		return "", fmt.Errorf("Failed to resolve credentials for %s: %w", hostname, err)
+	}
+
+	authConfig := types.AuthConfig{
+		Username:      cliAuth.Username,
+		Password:      cliAuth.Password,
+		Auth:          cliAuth.Auth,
+		Email:         cliAuth.Email,
+		ServerAddress: cliAuth.ServerAddress,
+		IdentityToken: cliAuth.IdentityToken,
+		RegistryToken: cliAuth.RegistryToken,
+	}
+
+	buf, err := json.Marshal(authConfig)
+	if err != nil {
+		return "", fmt.Errorf("Failed to encode auth config for %s: %w", hostname, err)
+	}
+	return base64.URLEncoding.EncodeToString(buf), nil
+}
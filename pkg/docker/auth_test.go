@@ -0,0 +1,59 @@
+package docker
+
+import (
+	"testing"
+
+	dockerregistry "github.com/docker/docker/registry"
+)
+
+func TestRegistryHostnameForAuth(t *testing.T) {
+	tests := []struct {
+		name  string
+		image string
+		want  string
+	}{
+		{
+			name:  "unqualified docker hub image",
+			image: "ubuntu:latest",
+			want:  dockerregistry.IndexServer,
+		},
+		{
+			name:  "explicit docker.io image",
+			image: "docker.io/library/ubuntu:latest",
+			want:  dockerregistry.IndexServer,
+		},
+		{
+			name:  "user docker hub image with no tag",
+			image: "replicate/cog-example",
+			want:  dockerregistry.IndexServer,
+		},
+		{
+			name:  "private registry",
+			image: "myregistry.example.com/team/model:latest",
+			want:  "myregistry.example.com",
+		},
+		{
+			name:  "gcr image",
+			image: "gcr.io/my-project/my-model@sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			want:  "gcr.io",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := registryHostnameForAuth(tt.image)
+			if err != nil {
+				t.Fatalf("registryHostnameForAuth(%q) returned error: %v", tt.image, err)
+			}
+			if got != tt.want {
+				t.Errorf("registryHostnameForAuth(%q) = %q, want %q", tt.image, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistryHostnameForAuthInvalidImage(t *testing.T) {
+	if _, err := registryHostnameForAuth("INVALID/////REF"); err == nil {
+		t.Fatal("expected an error for an unparseable image reference, got nil")
+	}
+}
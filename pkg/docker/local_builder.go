@@ -1,34 +1,61 @@
 package docker
 
 import (
-	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
-	"regexp"
+	"path/filepath"
 	"strings"
 
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/builder/dockerignore"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/archive"
+	"github.com/docker/docker/pkg/jsonmessage"
+
 	"github.com/replicate/cog/pkg/console"
 
 	"github.com/replicate/cog/pkg/logger"
-	"github.com/replicate/cog/pkg/shell"
 )
 
 const noRegistry = "no_registry"
 
+// BuildOptions controls how LocalImageBuilder.build invokes the Engine API.
+type BuildOptions struct {
+	BuildArgs map[string]*string
+	Labels    map[string]string
+	Target    string
+	CacheFrom []string
+	// UseBuildKit opts into the BuildKit builder. It defaults to false
+	// because BuildKit can't pass GPUs through at build time yet (see the
+	// TODO in build() below); callers must not derive this from the
+	// operator's ambient DOCKER_BUILDKIT env var, since many Docker
+	// installs default that to 1 and would silently reintroduce the
+	// GPU-build-time regression this option avoids.
+	UseBuildKit bool
+}
+
 type LocalImageBuilder struct {
 	registry string
+	client   *client.Client
 }
 
-func NewLocalImageBuilder(registry string) *LocalImageBuilder {
+func NewLocalImageBuilder(registry string) (*LocalImageBuilder, error) {
 	if registry == "" {
 		registry = noRegistry
 	}
-	return &LocalImageBuilder{registry: registry}
+	dockerClient, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, fmt.Errorf("Failed to connect to Docker client: %w", err)
+	}
+	return &LocalImageBuilder{registry: registry, client: dockerClient}, nil
 }
 
-func (b *LocalImageBuilder) BuildAndPush(dir string, dockerfilePath string, name string, logWriter logger.Logger) (fullImageTag string, err error) {
-	tag, err := b.build(dir, dockerfilePath, logWriter)
+func (b *LocalImageBuilder) BuildAndPush(dir string, dockerfilePath string, name string, opts BuildOptions, logWriter logger.Logger) (fullImageTag string, err error) {
+	tag, err := b.build(dir, dockerfilePath, opts, logWriter)
 	if err != nil {
 		return "", err
 	}
@@ -44,41 +71,121 @@ func (b *LocalImageBuilder) BuildAndPush(dir string, dockerfilePath string, name
 	return fullImageTag, nil
 }
 
-func (b *LocalImageBuilder) build(dir string, dockerfilePath string, logWriter logger.Logger) (tag string, err error) {
+// build invokes the Docker Engine API's ImageBuild, streaming progress to
+// logWriter and returning the built image ID reported in the response's aux
+// BuildResult frame.
+func (b *LocalImageBuilder) build(dir string, dockerfilePath string, opts BuildOptions, logWriter logger.Logger) (imageID string, err error) {
 	console.Debugf("Building in %s", dir)
 
-	cmd := exec.Command(
-		"docker", "build", ".",
-		"--progress", "plain",
-		"-f", dockerfilePath,
-		// "--build-arg", "BUILDKIT_INLINE_CACHE=1",
-	)
-	cmd.Dir = dir
-	// TODO(andreas): follow https://github.com/moby/buildkit/issues/1436, hopefully buildkit will be able to use GPUs soon
-	cmd.Env = append(os.Environ(), "DOCKER_BUILDKIT=0")
+	ctx := context.Background()
 
-	lastLogsChan, tagChan, err := buildPipe(cmd.StdoutPipe, logWriter)
+	excludes, err := readDockerignore(dir)
 	if err != nil {
 		return "", err
 	}
+	buildCtx, err := archive.TarWithOptions(dir, &archive.TarOptions{ExcludePatterns: excludes})
+	if err != nil {
+		return "", fmt.Errorf("Failed to create build context: %w", err)
+	}
+	defer buildCtx.Close()
+
+	buildOptions := types.ImageBuildOptions{
+		Dockerfile:  dockerfilePath,
+		BuildArgs:   opts.BuildArgs,
+		Labels:      opts.Labels,
+		Target:      opts.Target,
+		CacheFrom:   opts.CacheFrom,
+		Remove:      true,
+		ForceRemove: true,
+		Version:     types.BuilderV1,
+	}
+	// TODO(andreas): follow https://github.com/moby/buildkit/issues/1436, hopefully buildkit will be able to use GPUs soon
+	if opts.UseBuildKit {
+		buildOptions.Version = types.BuilderBuildKit
+	}
 
-	if err := cmd.Start(); err != nil {
-		return "", err
+	resp, err := b.client.ImageBuild(ctx, buildCtx, buildOptions)
+	if err != nil {
+		return "", fmt.Errorf("Failed to build image: %w", err)
 	}
+	defer resp.Body.Close()
 
-	if err = cmd.Wait(); err != nil {
-		lastLogs := <-lastLogsChan
-		for _, logLine := range lastLogs {
-			logWriter.Info(logLine)
+	auxCallback := func(msg jsonmessage.JSONMessage) {
+		if msg.Aux == nil {
+			return
 		}
-		return "", err
+		var result types.BuildResult
+		if err := json.Unmarshal(*msg.Aux, &result); err != nil {
+			return
+		}
+		imageID = result.ID
+	}
+
+	progressWriter := &buildProgressWriter{logWriter: logWriter}
+	if err := jsonmessage.DisplayJSONMessagesStream(resp.Body, progressWriter, 0, false, auxCallback); err != nil {
+		return "", fmt.Errorf("Failed to build image: %w", err)
+	}
+	if imageID == "" {
+		return "", fmt.Errorf("Docker build completed without reporting an image ID")
 	}
 
-	dockerTag := <-tagChan
+	logWriter.Infof("Successfully built %s", imageID)
+
+	return imageID, nil
+}
+
+func readDockerignore(dir string) ([]string, error) {
+	path := filepath.Join(dir, ".dockerignore")
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("Failed to open %s: %w", path, err)
+	}
+	defer f.Close()
 
-	logWriter.Infof("Successfully built %s", dockerTag)
+	excludes, err := dockerignore.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %w", path, err)
+	}
+	return excludes, nil
+}
 
-	return dockerTag, err
+// buildProgressWriter adapts the streamed build log into logWriter, keeping
+// the "section" progress lines (see SectionPrefix) that previously came from
+// scanning `docker build` stdout.
+type buildProgressWriter struct {
+	logWriter      logger.Logger
+	currentSection string
+	buf            []byte
+}
+
+func (w *buildProgressWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		idx := bytes.IndexByte(w.buf, '\n')
+		if idx < 0 {
+			break
+		}
+		line := strings.TrimRight(string(w.buf[:idx]), "\r")
+		w.buf = w.buf[idx+1:]
+		w.writeLine(line)
+	}
+	return len(p), nil
+}
+
+func (w *buildProgressWriter) writeLine(line string) {
+	if line == "" {
+		return
+	}
+	sectionPrefix := "RUN " + SectionPrefix
+	if strings.Contains(line, sectionPrefix) {
+		w.currentSection = strings.SplitN(line, sectionPrefix, 2)[1]
+		w.logWriter.Infof("  * %s", w.currentSection)
+		return
+	}
+	w.logWriter.Debug(line)
 }
 
 func (b *LocalImageBuilder) tag(tag string, fullImageTag string, logWriter logger.Logger) error {
@@ -97,86 +204,19 @@ func (b *LocalImageBuilder) tag(tag string, fullImageTag string, logWriter logge
 func (b *LocalImageBuilder) push(tag string, logWriter logger.Logger) error {
 	logWriter.Infof("Pushing %s to registry", tag)
 
-	args := []string{"push", tag}
-	cmd := exec.Command("docker", args...)
-	cmd.Env = os.Environ()
-
-	console.Debug("Pushing model to Registry...")
-	stderrDone, err := pipeToWithDockerChecks(cmd.StderrPipe, logWriter)
+	authStr, err := ResolveAuth(tag)
 	if err != nil {
 		return err
 	}
 
-	err = cmd.Run()
-	<-stderrDone
+	reader, err := b.client.ImagePush(context.Background(), tag, types.ImagePushOptions{RegistryAuth: authStr})
 	if err != nil {
-		return err
+		return fmt.Errorf("Failed to push %s: %w", tag, err)
 	}
-	return nil
-}
-
-func buildPipe(pf shell.PipeFunc, logWriter logger.Logger) (lastLogsChan chan []string, tagChan chan string, err error) {
-	// TODO: this is a hack, use Docker Go API instead
+	defer reader.Close()
 
-	// awkward logic: scan docker build output for the string
-	// "Successfully built" to find the newly built tag.
-	// BUT! that same string is used by pip, so we can only
-	// scan for it after we're done pip installing, hence
-	// we look for "LABEL" first. obviously this requires
-	// all LABELs to be at the end of the build script.
-
-	successPrefix := "Successfully built "
-	sectionPrefix := "RUN " + SectionPrefix
-	buildkitRegex := regexp.MustCompile("^#[0-9]+ writing image sha256:([0-9a-f]{12}).+$")
-	tagChan = make(chan string)
-
-	lastLogsChan = make(chan []string)
-
-	pipe, err := pf()
-	if err != nil {
-		return nil, nil, err
-	}
-	scanner := bufio.NewScanner(pipe)
-	go func() {
-		currentSection := SectionStartingBuild
-		currentLogLines := []string{}
-
-		for scanner.Scan() {
-			line := scanner.Text()
-			logWriter.Debug(line)
-
-			if strings.Contains(line, sectionPrefix) {
-				currentSection = strings.SplitN(line, sectionPrefix, 2)[1]
-				currentLogLines = []string{}
-				logWriter.Infof("  * %s", currentSection)
-			} else {
-				currentLogLines = append(currentLogLines, line)
-			}
-			if strings.HasPrefix(line, successPrefix) {
-				tagChan <- strings.TrimSpace(strings.TrimPrefix(line, successPrefix))
-			}
-			match := buildkitRegex.FindStringSubmatch(line)
-			if len(match) == 2 {
-				tagChan <- match[1]
-			}
-		}
-		lastLogsChan <- currentLogLines
-	}()
-
-	return lastLogsChan, tagChan, nil
+	if err := jsonmessage.DisplayJSONMessagesStream(reader, &buildProgressWriter{logWriter: logWriter}, 0, false, nil); err != nil {
+		return fmt.Errorf("Failed to push %s: %w", tag, err)
+	}
+	return nil
 }
-
-func pipeToWithDockerChecks(pf shell.PipeFunc, logWriter logger.Logger) (done chan struct{}, err error) {
-	return shell.PipeTo(pf, func(args ...interface{}) {
-		line := args[0].(string)
-		if strings.Contains(line, "Cannot connect to the Docker daemon") {
-			console.Fatal("Docker does not appear to be running; please start Docker and try again")
-		}
-		if strings.Contains(line, "failed to dial gRPC: unable to upgrade to h2c, received 502") {
-			console.Fatal("Your Docker version appears to be out out date; please upgrade Docker to the latest version and try again")
-		}
-		if logWriter != nil {
-			logWriter.Info(line)
-		}
-	})
-}
\ No newline at end of file
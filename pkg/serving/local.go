@@ -1,22 +1,29 @@
 package serving
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime"
 	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/docker/go-connections/nat"
 
 	"github.com/replicate/cog/pkg/console"
@@ -27,6 +34,17 @@ import (
 	"github.com/replicate/cog/pkg/shell"
 )
 
+// logWriterWriter adapts a logger.Logger to io.Writer so Engine API helpers
+// like jsonmessage.DisplayJSONMessagesStream can stream straight into it.
+type logWriterWriter struct {
+	logWriter logger.Logger
+}
+
+func (w logWriterWriter) Write(p []byte) (int, error) {
+	w.logWriter.Info(strings.TrimRight(string(p), "\n"))
+	return len(p), nil
+}
+
 type LocalDockerPlatform struct {
 	client *client.Client
 }
@@ -47,7 +65,7 @@ func NewLocalDockerPlatform() (*LocalDockerPlatform, error) {
 	}, nil
 }
 
-func (p *LocalDockerPlatform) Deploy(mod *model.Model, target string, logWriter logger.Logger) (Deployment, error) {
+func (p *LocalDockerPlatform) Deploy(mod *model.Model, target string, opts DeployOptions, logWriter logger.Logger) (Deployment, error) {
 	// TODO(andreas): output container logs
 
 	artifact, ok := mod.ArtifactFor(target)
@@ -58,20 +76,23 @@ func (p *LocalDockerPlatform) Deploy(mod *model.Model, target string, logWriter
 
 	logWriter.Infof("Deploying container %s for target %s", imageTag, artifact.Target)
 
+	ctx := context.Background()
+
 	if !docker.Exists(imageTag, logWriter) {
-		if err := docker.Pull(imageTag, logWriter); err != nil {
-			return nil, fmt.Errorf("Failed to pull image %s: %w", imageTag, err)
+		authStr, err := docker.ResolveAuth(imageTag)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to resolve registry credentials for %s: %w", imageTag, err)
+		}
+		reader, err := p.client.ImagePull(ctx, imageTag, types.ImagePullOptions{RegistryAuth: authStr})
+		if err != nil {
+			return nil, fmt.Errorf("Failed to pull Docker image %s: %w", imageTag, err)
+		}
+		defer reader.Close()
+		if err := jsonmessage.DisplayJSONMessagesStream(reader, logWriterWriter{logWriter}, 0, false, nil); err != nil {
+			return nil, fmt.Errorf("Failed to pull Docker image %s: %w", imageTag, err)
 		}
 	}
 
-	ctx := context.Background()
-	/* requires auth, therefore we just shell out for now
-	_, err := p.client.ImagePull(ctx, imageTag, types.ImagePullOptions{})
-	if err != nil {
-		return nil, fmt.Errorf("Failed to pull Docker image %s: %w", imageTag, err)
-	}
-	*/
-
 	hostPort, err := shell.NextFreePort(5000)
 	if err != nil {
 		return nil, err
@@ -93,11 +114,30 @@ func (p *LocalDockerPlatform) Deploy(mod *model.Model, target string, logWriter
 		ExposedPorts: nat.PortSet{
 			nat.Port(fmt.Sprintf("%d/tcp", jidPort)): struct{}{},
 		},
+		Env: opts.Env,
 	}
 	hostConfig := &container.HostConfig{
 		PortBindings: portBindings,
+		Mounts:       opts.Mounts,
+		Runtime:      opts.Runtime,
+		Resources: container.Resources{
+			Memory:         opts.Memory,
+			NanoCPUs:       opts.NanoCPUs,
+			DeviceRequests: gpuDeviceRequests(opts.GPUs),
+		},
+		ShmSize: opts.ShmSize,
+	}
+
+	var networkingConfig *network.NetworkingConfig
+	if len(opts.Networks) > 0 {
+		endpoints := map[string]*network.EndpointSettings{}
+		for _, networkName := range opts.Networks {
+			endpoints[networkName] = &network.EndpointSettings{}
+		}
+		networkingConfig = &network.NetworkingConfig{EndpointsConfig: endpoints}
 	}
-	resp, err := p.client.ContainerCreate(ctx, containerConfig, hostConfig, nil, nil, "")
+
+	resp, err := p.client.ContainerCreate(ctx, containerConfig, hostConfig, networkingConfig, nil, "")
 	if err != nil {
 		return nil, fmt.Errorf("Failed to create Docker container for image %s: %w", imageTag, err)
 	}
@@ -122,6 +162,49 @@ func (p *LocalDockerPlatform) Deploy(mod *model.Model, target string, logWriter
 	return deployment, nil
 }
 
+// gpuDeviceRequests translates the GPU device IDs from DeployOptions into
+// the DeviceRequests Docker's Engine API expects, the same shape `docker run
+// --gpus` produces. A nil/empty list requests no GPUs; a single "all" entry
+// requests every GPU on the host.
+func gpuDeviceRequests(gpus []string) []container.DeviceRequest {
+	if len(gpus) == 0 {
+		return nil
+	}
+	request := container.DeviceRequest{
+		Driver:       "nvidia",
+		Capabilities: [][]string{{"gpu"}},
+	}
+	if len(gpus) == 1 && gpus[0] == "all" {
+		request.Count = -1
+	} else {
+		request.DeviceIDs = gpus
+	}
+	return []container.DeviceRequest{request}
+}
+
+// maxHealthFailingStreak bounds how many consecutive failing HEALTHCHECK
+// runs we tolerate before giving up on a container that never goes healthy.
+const maxHealthFailingStreak = 3
+
+// waitForContainerReady prefers the container's native HEALTHCHECK status
+// over polling /ping itself: once an image declares its own HEALTHCHECK,
+// this returns as soon as the container reports "healthy", fails fast once
+// the failing streak crosses maxHealthFailingStreak, and surfaces the last
+// health-check output in the error so a bad model doesn't just look like a
+// generic timeout.
+//
+// Deploy does not inject a healthcheck of its own — forcing a
+// `curl`-based one onto every container would break images that don't
+// ship curl, which is most slim/python base images cog models are built
+// from. So cog-built images still have State.Health == nil and take the
+// /ping-poll fallback below; the HEALTHCHECK path only takes effect for
+// images that declare their own.
+//
+// TODO: this means HEALTHCHECK-based readiness isn't live for any
+// cog-built image today. Making it the real path needs a follow-up to
+// bake `HEALTHCHECK CMD curl -f http://localhost:5000/ping` into the
+// generated Dockerfile template (with curl installed alongside it), not
+// another change here.
 func (p *LocalDockerPlatform) waitForContainerReady(hostPort int, containerID string, logWriter logger.Logger) error {
 	url := fmt.Sprintf("http://localhost:%d/ping", hostPort)
 
@@ -139,22 +222,70 @@ func (p *LocalDockerPlatform) waitForContainerReady(hostPort int, containerID st
 		if err != nil {
 			return fmt.Errorf("Failed to get container status: %w", err)
 		}
-		if cont.State != nil && (cont.State.Status == "exited" || cont.State.Status == "dead") {
-			return fmt.Errorf("Container exited unexpectedly")
+		if cont.State == nil {
+			continue
+		}
+		if cont.State.OOMKilled {
+			return fmt.Errorf("Container was killed by the out-of-memory killer")
+		}
+		if cont.State.Status == "exited" || cont.State.Status == "dead" {
+			return fmt.Errorf("Container exited unexpectedly with code %d", cont.State.ExitCode)
 		}
 
-		resp, err := http.Get(url)
-		if err != nil {
-			continue
+		if cont.State.Health == nil {
+			// no HEALTHCHECK on this image, fall back to polling /ping
+			resp, err := http.Get(url)
+			if err != nil {
+				continue
+			}
+			if resp.StatusCode != http.StatusOK {
+				continue
+			}
+			logWriter.Infof("Got successful ping response from container")
+			return nil
 		}
-		if resp.StatusCode != http.StatusOK {
-			continue
+
+		switch status, failureErr := classifyHealth(cont.State.Health); status {
+		case healthStatusReady:
+			logWriter.Infof("Container is healthy")
+			return nil
+		case healthStatusFailed:
+			return failureErr
 		}
-		logWriter.Infof("Got successful ping response from container")
-		return nil
 	}
 }
 
+// healthClassification is the outcome of classifyHealth: whether the
+// container's HEALTHCHECK has settled one way or the other, or is still in
+// flight and waitForContainerReady should keep polling.
+type healthClassification int
+
+const (
+	healthStatusPending healthClassification = iota
+	healthStatusReady
+	healthStatusFailed
+)
+
+// classifyHealth turns a container's health state into a decision for
+// waitForContainerReady: ready once Docker reports "healthy", failed once
+// "unhealthy" has persisted for maxHealthFailingStreak checks (with the last
+// health-check output attached to the error), pending otherwise.
+func classifyHealth(health *types.Health) (healthClassification, error) {
+	switch health.Status {
+	case "healthy":
+		return healthStatusReady, nil
+	case "unhealthy":
+		if health.FailingStreak >= maxHealthFailingStreak {
+			lastOutput := ""
+			if n := len(health.Log); n > 0 {
+				lastOutput = strings.TrimSpace(health.Log[n-1].Output)
+			}
+			return healthStatusFailed, fmt.Errorf("Container failed to become healthy after %d attempts: %s", health.FailingStreak, lastOutput)
+		}
+	}
+	return healthStatusPending, nil
+}
+
 func (d *LocalDockerDeployment) Undeploy() error {
 	if err := d.client.ContainerStop(context.Background(), d.containerID, nil); err != nil {
 		return fmt.Errorf("Failed to stop Docker container %s: %w", d.containerID, err)
@@ -162,7 +293,9 @@ func (d *LocalDockerDeployment) Undeploy() error {
 	return nil
 }
 
-func (d *LocalDockerDeployment) RunInference(input *Example, logWriter logger.Logger) (*Result, error) {
+// buildInferenceRequestBody encodes input as a multipart form, the same
+// shape the cog model server's /infer endpoint expects.
+func buildInferenceRequestBody(input *Example) (*bytes.Buffer, string, error) {
 	bodyBuffer := new(bytes.Buffer)
 
 	mwriter := multipart.NewWriter(bodyBuffer)
@@ -170,37 +303,68 @@ func (d *LocalDockerDeployment) RunInference(input *Example, logWriter logger.Lo
 		if val.File != nil {
 			w, err := mwriter.CreateFormFile(key, filepath.Base(*val.File))
 			if err != nil {
-				return nil, err
+				return nil, "", err
 			}
 			file, err := os.Open(*val.File)
 			if err != nil {
-				return nil, err
+				return nil, "", err
 			}
 			if _, err := io.Copy(w, file); err != nil {
-				return nil, err
+				return nil, "", err
 			}
 			if err := file.Close(); err != nil {
-				return nil, err
+				return nil, "", err
 			}
 		} else {
 			w, err := mwriter.CreateFormField(key)
 			if err != nil {
-				return nil, err
+				return nil, "", err
 			}
 			if _, err = w.Write([]byte(*val.String)); err != nil {
-				return nil, err
+				return nil, "", err
 			}
 		}
 	}
 	if err := mwriter.Close(); err != nil {
-		return nil, fmt.Errorf("Failed to close form mime writer: %w", err)
+		return nil, "", fmt.Errorf("Failed to close form mime writer: %w", err)
 	}
+	return bodyBuffer, mwriter.FormDataContentType(), nil
+}
+
+// parseTimings reads the X-Setup-Time/X-Run-Time headers the model server
+// reports, logging (but not failing on) malformed values.
+func parseTimings(header http.Header) (setupTime float64, runTime float64) {
+	setupTime = -1.0
+	runTime = -1.0
+	if setupTimeStr := header.Get("X-Setup-Time"); setupTimeStr != "" {
+		if t, err := strconv.ParseFloat(setupTimeStr, 64); err != nil {
+			console.Errorf("Failed to parse setup time '%s' as float: %s", setupTimeStr, err)
+		} else {
+			setupTime = t
+		}
+	}
+	if runTimeStr := header.Get("X-Run-Time"); runTimeStr != "" {
+		if t, err := strconv.ParseFloat(runTimeStr, 64); err != nil {
+			console.Errorf("Failed to parse run time '%s' as float: %s", runTimeStr, err)
+		} else {
+			runTime = t
+		}
+	}
+	return setupTime, runTime
+}
+
+func (d *LocalDockerDeployment) RunInference(input *Example, logWriter logger.Logger) (*Result, error) {
+	bodyBuffer, contentType, err := buildInferenceRequestBody(input)
+	if err != nil {
+		return nil, err
+	}
+
 	url := fmt.Sprintf("http://localhost:%d/infer", d.port)
 	req, err := http.NewRequest(http.MethodPost, url, bodyBuffer)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to create HTTP request to %s: %w", url, err)
 	}
-	req.Header.Set("Content-Type", mwriter.FormDataContentType())
+	req.Header.Set("Content-Type", contentType)
 	req.Close = true
 
 	httpClient := &http.Client{}
@@ -216,45 +380,189 @@ func (d *LocalDockerDeployment) RunInference(input *Example, logWriter logger.Lo
 		return nil, fmt.Errorf("/infer call returned status %d", resp.StatusCode)
 	}
 
-	contentType := resp.Header.Get("Content-Type")
-	mimeType := strings.Split(contentType, ";")[0]
+	values := map[string]ResultValue{}
 
-	buf := new(bytes.Buffer)
-	if _, err := io.Copy(buf, resp.Body); err != nil {
-		return nil, fmt.Errorf("Failed to read response: %w", err)
-	}
-
-	setupTime := -1.0
-	runTime := -1.0
-	setupTimeStr := resp.Header.Get("X-Setup-Time")
-	if setupTimeStr != "" {
-		setupTime, err = strconv.ParseFloat(setupTimeStr, 64)
-		if err != nil {
-			console.Errorf("Failed to parse setup time '%s' as float: %s", setupTimeStr, err)
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err == nil && strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(resp.Body, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("Failed to read response: %w", err)
+			}
+			name := part.FormName()
+			if name == "" {
+				name = "output"
+			}
+			buf := new(bytes.Buffer)
+			if _, err := io.Copy(buf, part); err != nil {
+				return nil, fmt.Errorf("Failed to read response: %w", err)
+			}
+			values[name] = ResultValue{
+				Buffer:   buf,
+				MimeType: strings.Split(part.Header.Get("Content-Type"), ";")[0],
+			}
 		}
-	}
-	runTimeStr := resp.Header.Get("X-Run-Time")
-	if runTimeStr != "" {
-		runTime, err = strconv.ParseFloat(runTimeStr, 64)
-		if err != nil {
-			console.Errorf("Failed to parse run time '%s' as float: %s", runTimeStr, err)
+	} else {
+		buf := new(bytes.Buffer)
+		if _, err := io.Copy(buf, resp.Body); err != nil {
+			return nil, fmt.Errorf("Failed to read response: %w", err)
+		}
+		values["output"] = ResultValue{
+			Buffer:   buf,
+			MimeType: strings.Split(resp.Header.Get("Content-Type"), ";")[0],
 		}
 	}
 
+	setupTime, runTime := parseTimings(resp.Header)
+
 	result := &Result{
-		Values: map[string]ResultValue{
-			// TODO(andreas): support multiple outputs?
-			"output": {
-				Buffer:   buf,
-				MimeType: mimeType,
-			},
-		},
+		Values:    values,
 		SetupTime: setupTime,
 		RunTime:   runTime,
 	}
 	return result, nil
 }
 
+// RunInferenceStream behaves like RunInference but surfaces each output as
+// it arrives rather than buffering the whole response first: multipart/mixed
+// parts are emitted as separate ResultEvents, each piped from the live HTTP
+// body without buffering. Cancelling ctx stops the HTTP read; if ctx's
+// deadline is what ended it, the backing container is killed so a hung
+// prediction can't keep running after the caller has given up.
+//
+// Callers must keep reading events (and the Buffer of each event they're
+// given) until a Done or Err event arrives, or until they cancel ctx — every
+// send below is bounded by ctx.Done() so an abandoned channel doesn't leak
+// this goroutine forever, but it won't make progress until either the event
+// is received or ctx ends.
+func (d *LocalDockerDeployment) RunInferenceStream(ctx context.Context, input *Example) (<-chan ResultEvent, error) {
+	bodyBuffer, contentType, err := buildInferenceRequestBody(input)
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("http://localhost:%d/infer", d.port)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bodyBuffer)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create HTTP request to %s: %w", url, err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Close = true
+
+	httpClient := &http.Client{}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to POST HTTP request to %s: %w", url, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("/infer call returned status %d", resp.StatusCode)
+	}
+
+	events := make(chan ResultEvent)
+
+	go func() {
+		defer close(events)
+
+		watchDone := make(chan struct{})
+		defer close(watchDone)
+		go func() {
+			select {
+			case <-ctx.Done():
+				if ctx.Err() == context.DeadlineExceeded {
+					_ = d.client.ContainerKill(context.Background(), d.containerID, "KILL")
+				}
+				resp.Body.Close()
+			case <-watchDone:
+			}
+		}()
+		defer resp.Body.Close()
+
+		// sendEvent bounds every send on ctx, so an abandoned consumer
+		// can't wedge this goroutine open forever.
+		sendEvent := func(ev ResultEvent) bool {
+			select {
+			case events <- ev:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		if err == nil && strings.HasPrefix(mediaType, "multipart/") {
+			mr := multipart.NewReader(resp.Body, params["boundary"])
+			for {
+				part, err := mr.NextPart()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					sendEvent(ResultEvent{Err: fmt.Errorf("Failed to read response: %w", err)})
+					return
+				}
+				name := part.FormName()
+				if name == "" {
+					name = "output"
+				}
+
+				// NextPart() discards any unread bytes of the previous
+				// part the instant it's called, so we can't hand out
+				// `part` itself and loop immediately - pipe it through
+				// and block until the consumer has drained it.
+				pr, pw := io.Pipe()
+				copyDone := make(chan struct{})
+				go func() {
+					_, copyErr := io.Copy(pw, part)
+					pw.CloseWithError(copyErr)
+					close(copyDone)
+				}()
+
+				if !sendEvent(ResultEvent{
+					Name: name,
+					Value: ResultValue{
+						Buffer:   pr,
+						MimeType: strings.Split(part.Header.Get("Content-Type"), ";")[0],
+					},
+				}) {
+					pr.CloseWithError(ctx.Err())
+					<-copyDone
+					return
+				}
+
+				select {
+				case <-copyDone:
+				case <-ctx.Done():
+					// Consumer accepted the event but never drained pr (or
+					// ctx ended mid-read); unblock io.Copy's pending Write
+					// instead of leaking the copy goroutine and HTTP conn.
+					pr.CloseWithError(ctx.Err())
+					<-copyDone
+					return
+				}
+			}
+		} else {
+			sendEvent(ResultEvent{
+				Name: "output",
+				Value: ResultValue{
+					Buffer:   resp.Body,
+					MimeType: strings.Split(resp.Header.Get("Content-Type"), ";")[0],
+				},
+			})
+		}
+
+		setupTime, runTime := parseTimings(resp.Header)
+		sendEvent(ResultEvent{Done: true, SetupTime: setupTime, RunTime: runTime})
+	}()
+
+	return events, nil
+}
+
 func (d *LocalDockerDeployment) Help(logWriter logger.Logger) (*HelpResponse, error) {
 	resp, err := http.Get(fmt.Sprintf("http://localhost:%d/help", d.port))
 	if err != nil {
@@ -295,9 +603,119 @@ func getContainerLogs(c *client.Client, containerID string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	data, err := io.ReadAll(reader)
-	if err != nil {
+	defer reader.Close()
+
+	var buf bytes.Buffer
+	if _, err := stdcopy.StdCopy(&buf, &buf, reader); err != nil {
 		return "", err
 	}
-	return string(data), nil
+	return buf.String(), nil
+}
+
+// Logs follows the container's stdout/stderr, demultiplexing the framed
+// stream the Engine API returns and yielding one LogLine per line as it
+// arrives. Cancelling ctx stops the underlying read.
+func (d *LocalDockerDeployment) Logs(ctx context.Context, opts LogOptions) (<-chan LogLine, error) {
+	reader, err := d.client.ContainerLogs(ctx, d.containerID, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     opts.Follow,
+		Since:      opts.Since,
+		Tail:       opts.Tail,
+		Timestamps: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get logs for container %s: %w", d.containerID, err)
+	}
+
+	lines := make(chan LogLine)
+	stdoutReader, stdoutWriter := io.Pipe()
+	stderrReader, stderrWriter := io.Pipe()
+
+	go func() {
+		_, err := stdcopy.StdCopy(stdoutWriter, stderrWriter, reader)
+		stdoutWriter.CloseWithError(err)
+		stderrWriter.CloseWithError(err)
+		reader.Close()
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go streamLogLines(ctx, stdoutReader, "stdout", lines, &wg)
+	go streamLogLines(ctx, stderrReader, "stderr", lines, &wg)
+	go func() {
+		wg.Wait()
+		close(lines)
+	}()
+
+	return lines, nil
+}
+
+// streamLogLines scans timestamped log lines (the "<RFC3339Nano> <message>"
+// format Timestamps: true produces) off r and sends one LogLine per line.
+// Every send is bounded by ctx so an abandoned consumer (one that stops
+// draining lines, or whose ctx is cancelled mid-line) can't block this
+// goroutine forever. If ctx fires first, r is closed with ctx.Err() so the
+// StdCopy producer blocked writing to it is released instead of leaking.
+func streamLogLines(ctx context.Context, r *io.PipeReader, stream string, lines chan<- LogLine, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		var logTime time.Time
+		message := line
+		if idx := strings.IndexByte(line, ' '); idx >= 0 {
+			if parsed, err := time.Parse(time.RFC3339Nano, line[:idx]); err == nil {
+				logTime = parsed
+				message = line[idx+1:]
+			}
+		}
+
+		select {
+		case lines <- LogLine{Stream: stream, Time: logTime, Message: message}:
+		case <-ctx.Done():
+			r.CloseWithError(ctx.Err())
+			return
+		}
+	}
+}
+
+// Events reports container lifecycle events (die, oom, health_status, ...)
+// for as long as ctx is alive, so callers can react to state transitions
+// instead of polling ContainerInspect.
+func (d *LocalDockerDeployment) Events(ctx context.Context) (<-chan Event, error) {
+	filterArgs := filters.NewArgs()
+	filterArgs.Add("container", d.containerID)
+
+	msgs, errs := d.client.Events(ctx, types.EventsOptions{Filters: filterArgs})
+
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		for {
+			select {
+			case msg, ok := <-msgs:
+				if !ok {
+					return
+				}
+				select {
+				case events <- Event{
+					Type:   string(msg.Type),
+					Action: string(msg.Action),
+					Time:   time.Unix(0, msg.TimeNano),
+				}:
+				case <-ctx.Done():
+					return
+				}
+			case <-errs:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return events, nil
 }
\ No newline at end of file
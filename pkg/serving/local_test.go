@@ -0,0 +1,138 @@
+package serving
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestClassifyHealth(t *testing.T) {
+	tests := []struct {
+		name            string
+		health          *types.Health
+		wantStatus      healthClassification
+		wantErr         bool
+		wantErrContains string
+	}{
+		{
+			name:       "healthy",
+			health:     &types.Health{Status: "healthy"},
+			wantStatus: healthStatusReady,
+		},
+		{
+			name:       "starting",
+			health:     &types.Health{Status: "starting"},
+			wantStatus: healthStatusPending,
+		},
+		{
+			name:       "unhealthy below failing streak threshold",
+			health:     &types.Health{Status: "unhealthy", FailingStreak: maxHealthFailingStreak - 1},
+			wantStatus: healthStatusPending,
+		},
+		{
+			name: "unhealthy at failing streak threshold fails with last log output",
+			health: &types.Health{
+				Status:        "unhealthy",
+				FailingStreak: maxHealthFailingStreak,
+				Log: []*types.HealthcheckResult{
+					{Output: "connection refused"},
+					{Output: "  still refusing connections  "},
+				},
+			},
+			wantStatus:      healthStatusFailed,
+			wantErr:         true,
+			wantErrContains: "still refusing connections",
+		},
+		{
+			name: "unhealthy past threshold with no log",
+			health: &types.Health{
+				Status:        "unhealthy",
+				FailingStreak: maxHealthFailingStreak + 1,
+			},
+			wantStatus: healthStatusFailed,
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, err := classifyHealth(tt.health)
+			if status != tt.wantStatus {
+				t.Errorf("classifyHealth() status = %v, want %v", status, tt.wantStatus)
+			}
+			if tt.wantErr && err == nil {
+				t.Fatal("classifyHealth() expected an error, got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("classifyHealth() unexpected error: %v", err)
+			}
+			if tt.wantErrContains != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErrContains)) {
+				t.Errorf("classifyHealth() error = %v, want to contain %q", err, tt.wantErrContains)
+			}
+		})
+	}
+}
+
+func TestGPUDeviceRequests(t *testing.T) {
+	tests := []struct {
+		name string
+		gpus []string
+		want []container.DeviceRequest
+	}{
+		{
+			name: "no GPUs requested",
+			gpus: nil,
+			want: nil,
+		},
+		{
+			name: "empty GPU list",
+			gpus: []string{},
+			want: nil,
+		},
+		{
+			name: "all GPUs requested",
+			gpus: []string{"all"},
+			want: []container.DeviceRequest{
+				{
+					Driver:       "nvidia",
+					Capabilities: [][]string{{"gpu"}},
+					Count:        -1,
+				},
+			},
+		},
+		{
+			name: "specific device IDs",
+			gpus: []string{"0", "2"},
+			want: []container.DeviceRequest{
+				{
+					Driver:       "nvidia",
+					Capabilities: [][]string{{"gpu"}},
+					DeviceIDs:    []string{"0", "2"},
+				},
+			},
+		},
+		{
+			name: "single device ID other than all",
+			gpus: []string{"1"},
+			want: []container.DeviceRequest{
+				{
+					Driver:       "nvidia",
+					Capabilities: [][]string{{"gpu"}},
+					DeviceIDs:    []string{"1"},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := gpuDeviceRequests(tt.gpus)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("gpuDeviceRequests(%v) = %+v, want %+v", tt.gpus, got, tt.want)
+			}
+		})
+	}
+}
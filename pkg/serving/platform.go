@@ -1,24 +1,74 @@
 package serving
 
 import (
+	"context"
 	"io"
 	"path/filepath"
 	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/mount"
 
 	"github.com/replicate/cog/pkg/logger"
 	"github.com/replicate/cog/pkg/model"
 )
 
 type Platform interface {
-	Deploy(mod *model.Model, target string, logWriter logger.Logger) (Deployment, error)
+	Deploy(mod *model.Model, target string, opts DeployOptions, logWriter logger.Logger) (Deployment, error)
+}
+
+// DeployOptions configures the container a Platform starts for serving a
+// model, mirroring the knobs `docker run` exposes for GPUs, resource limits,
+// and mounts.
+type DeployOptions struct {
+	// GPUs lists device IDs to expose to the container (as in `docker run
+	// --gpus`). A single entry of "all" exposes every GPU on the host.
+	GPUs []string
+
+	Memory   int64
+	NanoCPUs int64
+	ShmSize  int64
+
+	Mounts []mount.Mount
+	Env    []string
+
+	Networks []string
+	Runtime  string
 }
 
 type Deployment interface {
 	RunInference(input *Example, logWriter logger.Logger) (*Result, error)
+	RunInferenceStream(ctx context.Context, input *Example) (<-chan ResultEvent, error)
 	Help(logWriter logger.Logger) (*HelpResponse, error)
+	Logs(ctx context.Context, opts LogOptions) (<-chan LogLine, error)
+	Events(ctx context.Context) (<-chan Event, error)
 	Undeploy() error
 }
 
+// LogOptions controls Deployment.Logs, mirroring the subset of `docker logs`
+// flags that matter for a long-running model container.
+type LogOptions struct {
+	Follow bool
+	Since  string
+	Tail   string
+}
+
+// LogLine is one demultiplexed, timestamped line from a container's
+// stdout/stderr.
+type LogLine struct {
+	Stream  string // "stdout" or "stderr"
+	Time    time.Time
+	Message string
+}
+
+// Event is a container lifecycle event (e.g. "die", "oom", "health_status")
+// reported by the Engine API's event stream.
+type Event struct {
+	Type   string
+	Action string
+	Time   time.Time
+}
+
 type ExampleValue struct {
 	String *string
 	File   *string
@@ -67,6 +117,21 @@ type Result struct {
 	RunTime   float64
 }
 
+// ResultEvent is emitted incrementally by RunInferenceStream as outputs
+// arrive from the model server, rather than waiting for the whole response.
+// A non-nil Err ends the stream. Once Done is true, SetupTime/RunTime are
+// populated and no further events follow.
+type ResultEvent struct {
+	Name  string
+	Value ResultValue
+	Done  bool
+
+	SetupTime float64
+	RunTime   float64
+
+	Err error
+}
+
 type HelpResponse struct {
 	Arguments map[string]*model.RunArgument `json:"arguments"`
 }
\ No newline at end of file